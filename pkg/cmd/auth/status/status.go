@@ -0,0 +1,360 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/cli/cli/v2/api"
+	"github.com/cli/cli/v2/internal/config"
+	"github.com/cli/cli/v2/pkg/cmdutil"
+	"github.com/cli/cli/v2/pkg/iostreams"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultConcurrency is the number of hosts probed at once unless the user
+// overrides it with --concurrency.
+const defaultConcurrency = 4
+
+// defaultRequiredScopes is the minimum set of OAuth scopes every
+// authenticated host is expected to carry for `gh` itself to function,
+// used unless the user overrides it with --required-scopes.
+var defaultRequiredScopes = []string{"repo", "read:org", "gist", "workflow"}
+
+// tokenMaskLength is the number of asterisks used to redact a token so that
+// its length never leaks alongside it.
+const tokenMaskLength = 19
+
+type StatusOptions struct {
+	HttpClient func() (*http.Client, error)
+	IO         *iostreams.IOStreams
+	Config     func() (config.Config, error)
+	Exporter   cmdutil.Exporter
+
+	Timeout time.Duration
+
+	Hostname       string
+	ShowToken      bool
+	RequiredScopes []string
+	Concurrency    int
+	FailFast       bool
+}
+
+// HostStatus is everything we learn while probing a single host's
+// authentication state. It backs both the prose output and --json export.
+type HostStatus struct {
+	Hostname    string   `json:"hostname"`
+	User        string   `json:"user"`
+	Token       string   `json:"token"`
+	TokenSource string   `json:"tokenSource"`
+	Scopes      []string `json:"scopes"`
+	Protocol    string   `json:"protocol"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// hostResult pairs a host's structured status with the human-readable lines
+// describing it, so a goroutine can hand both back without touching shared
+// state.
+type hostResult struct {
+	status HostStatus
+	lines  []string
+}
+
+var statusFields = []string{"hostname", "user", "token", "tokenSource", "scopes", "protocol", "error"}
+
+func NewCmdStatus(f *cmdutil.Factory, runF func(*StatusOptions) error) *cobra.Command {
+	opts := &StatusOptions{
+		HttpClient: f.HttpClient,
+		IO:         f.IOStreams,
+		Config:     f.Config,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Args:  cobra.ExactArgs(0),
+		Short: "View authentication status",
+		Long: heredoc.Doc(`Verifies and displays information about your authentication state.
+
+			This command will test your authentication state for each GitHub host that gh knows about and
+			report on any issues.
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if runF != nil {
+				return runF(opts)
+			}
+			return statusRun(cmd.Context(), opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Hostname, "hostname", "h", "", "Check a specific hostname's auth status")
+	cmd.Flags().BoolVar(&opts.ShowToken, "show-token", false, "Display the auth token")
+	cmd.Flags().StringSliceVar(&opts.RequiredScopes, "required-scopes", nil,
+		"Comma separated list of scopes to require for each host (default \"repo,read:org,gist,workflow\")")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 0, "Cancel each host's checks if they take longer than this (e.g. \"20s\")")
+	cmd.Flags().IntVar(&opts.Concurrency, "concurrency", defaultConcurrency, "Number of hosts to probe at once")
+	cmd.Flags().BoolVar(&opts.FailFast, "fail-fast", false, "Cancel remaining host checks as soon as one host fails")
+	cmdutil.AddJSONFlags(cmd, &opts.Exporter, statusFields)
+
+	return cmd
+}
+
+func statusRun(ctx context.Context, opts *StatusOptions) error {
+	cfg, err := opts.Config()
+	if err != nil {
+		return err
+	}
+
+	stderr := opts.IO.ErrOut
+	cs := opts.IO.ColorScheme()
+
+	hostnames, err := cfg.Hosts()
+	if err != nil {
+		return err
+	}
+	if len(hostnames) == 0 {
+		fmt.Fprintf(stderr,
+			"You are not logged into any GitHub hosts. Run %s to authenticate.\n", cs.Bold("gh auth login"))
+		return cmdutil.SilentError
+	}
+
+	required := opts.RequiredScopes
+	if len(required) == 0 {
+		required = defaultRequiredScopes
+	}
+
+	var targets []string
+	for _, hostname := range hostnames {
+		if opts.Hostname != "" && opts.Hostname != hostname {
+			continue
+		}
+		targets = append(targets, hostname)
+	}
+	if len(targets) == 0 {
+		fmt.Fprintf(stderr, "Hostname %q not found among authenticated GitHub hosts\n", opts.Hostname)
+		return cmdutil.SilentError
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = defaultConcurrency
+	}
+
+	results := make([]hostResult, len(targets))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for i, hostname := range targets {
+		i, hostname := i, hostname
+		g.Go(func() error {
+			r := probeHost(gctx, opts, cfg, cs, hostname, required)
+			results[i] = r
+			if opts.FailFast && r.status.Error != "" {
+				return fmt.Errorf("%s: %s", hostname, r.status.Error)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	var failed bool
+	statuses := make([]HostStatus, len(results))
+	for i, r := range results {
+		statuses[i] = r.status
+		if r.status.Error != "" {
+			failed = true
+		}
+	}
+
+	if opts.Exporter != nil {
+		if err := opts.Exporter.Write(opts.IO, statuses); err != nil {
+			return err
+		}
+		if failed {
+			return cmdutil.SilentError
+		}
+		return nil
+	}
+
+	for i, hostname := range targets {
+		fmt.Fprintf(stderr, "%s\n", cs.Bold(hostname))
+		for _, line := range results[i].lines {
+			fmt.Fprintf(stderr, "  %s\n", line)
+		}
+	}
+
+	if failed {
+		return cmdutil.SilentError
+	}
+
+	return nil
+}
+
+// probeHost checks a single host's authentication state: its token's
+// validity, its granted scopes against required, and who it belongs to. It
+// touches no shared state so it is safe to run concurrently across hosts.
+//
+// ctx is checked before any network call is made so that, with --fail-fast,
+// a host whose turn comes up after a sibling has already failed is skipped
+// instead of probed.
+func probeHost(ctx context.Context, opts *StatusOptions, cfg config.Config, cs *iostreams.ColorScheme, hostname string, required []string) hostResult {
+	var lines []string
+	addMsg := func(x string, ys ...interface{}) {
+		lines = append(lines, fmt.Sprintf(x, ys...))
+	}
+
+	hs := HostStatus{Hostname: hostname}
+
+	if err := ctx.Err(); err != nil {
+		addMsg("%s %s: %s", cs.Red("X"), hostname, err)
+		hs.Error = err.Error()
+		return hostResult{status: hs, lines: lines}
+	}
+
+	token, tokenSource, _ := cfg.GetWithSource(hostname, "oauth_token")
+	protocol, _ := cfg.Get(hostname, "git_protocol")
+
+	if isEnvVarSource(tokenSource) {
+		addMsg("%s %s is set and is being used instead of any stored credentials for %s.",
+			cs.Yellow("!"), tokenSource, hostname)
+	}
+
+	hs.Token = displayToken(token, opts.ShowToken)
+	hs.TokenSource = tokenSource
+	hs.Protocol = protocol
+
+	httpClient, err := opts.HttpClient()
+	if err != nil {
+		addMsg("%s %s: %s", cs.Red("X"), hostname, err)
+		hs.Error = err.Error()
+		return hostResult{status: hs, lines: lines}
+	}
+	if opts.Timeout != 0 {
+		clone := *httpClient
+		clone.Timeout = opts.Timeout
+		httpClient = &clone
+	}
+	apiClient := api.NewClientFromHTTP(httpClient)
+
+	scopesHeader, err := api.TokenScopes(httpClient, hostname, token)
+	if err != nil {
+		addMsg("%s %s: authentication failed", cs.Red("X"), hostname)
+		addMsg("- The %s token in %s is no longer valid.", hostname, describeTokenSource(tokenSource))
+		if tokenSource == "oauth_token" {
+			addMsg("- To re-authenticate, run: %s %s", cs.Bold("gh auth login -h"), hostname)
+			addMsg("- To forget about this host, run: %s %s", cs.Bold("gh auth logout -h"), hostname)
+		}
+		hs.Error = err.Error()
+		return hostResult{status: hs, lines: lines}
+	}
+	hs.Scopes = parseScopes(scopesHeader)
+
+	if missing := missingScopes(hs.Scopes, required); len(missing) > 0 {
+		addMsg("%s %s: missing required token scopes %s", cs.Red("X"), hostname, strings.Join(missing, ", "))
+		if tokenSource == "oauth_token" {
+			for _, scope := range missing {
+				addMsg("- To add the %s scope, run: %s", scope,
+					cs.Bold(fmt.Sprintf("gh auth refresh -h %s -s %s", hostname, scope)))
+			}
+		}
+		hs.Error = fmt.Sprintf("missing required scopes %s", strings.Join(missing, ", "))
+		return hostResult{status: hs, lines: lines}
+	}
+
+	username, err := api.CurrentLoginName(apiClient, hostname)
+	if err != nil {
+		addMsg("%s %s: api call failed: %s", cs.Red("X"), hostname, err)
+		hs.Error = err.Error()
+		return hostResult{status: hs, lines: lines}
+	}
+	hs.User = username
+
+	addMsg("%s Logged in to %s as %s (%s)", cs.SuccessIcon(), hostname, cs.Bold(username), describeTokenSource(tokenSource))
+	if protocol != "" {
+		addMsg("%s Git operations for %s configured to use %s protocol.", cs.SuccessIcon(), hostname, cs.Bold(protocol))
+	}
+	addMsg("%s Token: %s", cs.SuccessIcon(), hs.Token)
+
+	return hostResult{status: hs, lines: lines}
+}
+
+func parseScopes(scopesHeader string) []string {
+	if scopesHeader == "" {
+		return nil
+	}
+	var scopes []string
+	for _, s := range strings.Split(scopesHeader, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+func missingScopes(have, required []string) []string {
+	var missing []string
+	for _, r := range required {
+		found := false
+		for _, h := range have {
+			if h == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// CheckScopes reports which of the required scopes are missing from the
+// token's granted scopes on hostname, so callers can prompt for a
+// `gh auth refresh` before invoking a scope-gated API.
+func CheckScopes(httpClient *http.Client, hostname, token string, required []string) ([]string, error) {
+	scopesHeader, err := api.TokenScopes(httpClient, hostname, token)
+	if err != nil {
+		return nil, err
+	}
+	return missingScopes(parseScopes(scopesHeader), required), nil
+}
+
+// tokenEnvVars are the environment variables that take precedence over a
+// host's stored oauth_token, in the order config.GetWithSource checks them.
+var tokenEnvVars = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN", "GH_TOKEN", "GITHUB_TOKEN"}
+
+func isEnvVarSource(source string) bool {
+	for _, v := range tokenEnvVars {
+		if source == v {
+			return true
+		}
+	}
+	return false
+}
+
+// describeTokenSource turns the raw source config.GetWithSource reports into
+// the human-readable label shown in `gh auth status` output.
+func describeTokenSource(source string) string {
+	if isEnvVarSource(source) {
+		return fmt.Sprintf("environment variable %s", source)
+	}
+	switch source {
+	case "oauth_token":
+		return "config file"
+	case "keyring":
+		return "keyring"
+	default:
+		return source
+	}
+}
+
+func displayToken(token string, printRaw bool) string {
+	if printRaw {
+		return token
+	}
+	return strings.Repeat("*", tokenMaskLength)
+}
@@ -2,9 +2,13 @@ package status
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"net/http"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cli/cli/v2/internal/config"
 	"github.com/cli/cli/v2/pkg/cmdutil"
@@ -39,6 +43,13 @@ func Test_NewCmdStatus(t *testing.T) {
 				ShowToken: true,
 			},
 		},
+		{
+			name: "required scopes set",
+			cli:  "--required-scopes gist,workflow",
+			wants: StatusOptions{
+				RequiredScopes: []string{"gist", "workflow"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -66,6 +77,7 @@ func Test_NewCmdStatus(t *testing.T) {
 			assert.NoError(t, err)
 
 			assert.Equal(t, tt.wants.Hostname, gotOpts.Hostname)
+			assert.Equal(t, tt.wants.RequiredScopes, gotOpts.RequiredScopes)
 		})
 	}
 }
@@ -76,9 +88,76 @@ func Test_statusRun(t *testing.T) {
 		opts       *StatusOptions
 		httpStubs  func(*httpmock.Registry)
 		cfg        func(config.Config)
+		env        map[string]string
 		wantErr    string
 		wantErrOut *regexp.Regexp
 	}{
+		{
+			name: "token from environment",
+			opts: &StatusOptions{},
+			env: map[string]string{
+				"GH_TOKEN": "abc123",
+			},
+			cfg: func(c config.Config) {},
+			httpStubs: func(reg *httpmock.Registry) {
+				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
+				reg.Register(
+					httpmock.GraphQL(`query UserCurrent\b`),
+					httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
+			},
+			wantErrOut: regexp.MustCompile(`(?s)GH_TOKEN is set and is being used.*Logged in to github.com as.*tess.*\(environment variable GH_TOKEN\)`),
+		},
+		{
+			name: "token from environment overrides stored token",
+			opts: &StatusOptions{},
+			env: map[string]string{
+				"GH_TOKEN": "abc123",
+			},
+			cfg: func(c config.Config) {
+				_ = c.Set("github.com", "oauth_token", "xyz456")
+			},
+			httpStubs: func(reg *httpmock.Registry) {
+				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
+				reg.Register(
+					httpmock.GraphQL(`query UserCurrent\b`),
+					httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
+			},
+			wantErrOut: regexp.MustCompile(`GH_TOKEN is set and is being used instead of any stored credentials for github.com`),
+		},
+		{
+			name: "timeout exceeded",
+			opts: &StatusOptions{
+				Timeout: -1 * time.Second,
+			},
+			cfg: func(c config.Config) {
+				_ = c.Set("github.com", "oauth_token", "abc123")
+			},
+			httpStubs: func(reg *httpmock.Registry) {
+				reg.Register(httpmock.REST("GET", ""), func(req *http.Request) (*http.Response, error) {
+					if err := req.Context().Err(); err != nil {
+						return nil, err
+					}
+					return httpmock.ScopesResponder("repo,read:org,gist,workflow")(req)
+				})
+			},
+			wantErrOut: regexp.MustCompile(`github\.com: authentication failed`),
+			wantErr:    "SilentError",
+		},
+		{
+			name: "missing custom required scope",
+			opts: &StatusOptions{
+				Hostname:       "github.com",
+				RequiredScopes: []string{"repo", "gist"},
+			},
+			cfg: func(c config.Config) {
+				_ = c.Set("github.com", "oauth_token", "abc123")
+			},
+			httpStubs: func(reg *httpmock.Registry) {
+				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org"))
+			},
+			wantErrOut: regexp.MustCompile(`(?s)missing required token scopes gist.*gh auth refresh -h github\.com -s gist`),
+			wantErr:    "SilentError",
+		},
 		{
 			name: "hostname set",
 			opts: &StatusOptions{
@@ -89,7 +168,7 @@ func Test_statusRun(t *testing.T) {
 				_ = c.Set("github.com", "oauth_token", "abc123")
 			},
 			httpStubs: func(reg *httpmock.Registry) {
-				reg.Register(httpmock.REST("GET", "api/v3/"), httpmock.ScopesResponder("repo,read:org"))
+				reg.Register(httpmock.REST("GET", "api/v3/"), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
 				reg.Register(
 					httpmock.GraphQL(`query UserCurrent\b`),
 					httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
@@ -105,7 +184,7 @@ func Test_statusRun(t *testing.T) {
 			},
 			httpStubs: func(reg *httpmock.Registry) {
 				reg.Register(httpmock.REST("GET", "api/v3/"), httpmock.ScopesResponder("repo"))
-				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org"))
+				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
 				reg.Register(
 					httpmock.GraphQL(`query UserCurrent\b`),
 					httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
@@ -122,7 +201,7 @@ func Test_statusRun(t *testing.T) {
 			},
 			httpStubs: func(reg *httpmock.Registry) {
 				reg.Register(httpmock.REST("GET", "api/v3/"), httpmock.StatusStringResponse(400, "no bueno"))
-				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org"))
+				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
 				reg.Register(
 					httpmock.GraphQL(`query UserCurrent\b`),
 					httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
@@ -138,8 +217,8 @@ func Test_statusRun(t *testing.T) {
 				_ = c.Set("github.com", "oauth_token", "abc123")
 			},
 			httpStubs: func(reg *httpmock.Registry) {
-				reg.Register(httpmock.REST("GET", "api/v3/"), httpmock.ScopesResponder("repo,read:org"))
-				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org"))
+				reg.Register(httpmock.REST("GET", "api/v3/"), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
+				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
 				reg.Register(
 					httpmock.GraphQL(`query UserCurrent\b`),
 					httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
@@ -157,8 +236,8 @@ func Test_statusRun(t *testing.T) {
 				_ = c.Set("github.com", "oauth_token", "xyz456")
 			},
 			httpStubs: func(reg *httpmock.Registry) {
-				reg.Register(httpmock.REST("GET", "api/v3/"), httpmock.ScopesResponder("repo,read:org"))
-				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org"))
+				reg.Register(httpmock.REST("GET", "api/v3/"), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
+				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
 				reg.Register(
 					httpmock.GraphQL(`query UserCurrent\b`),
 					httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
@@ -178,8 +257,8 @@ func Test_statusRun(t *testing.T) {
 				_ = c.Set("github.com", "oauth_token", "xyz456")
 			},
 			httpStubs: func(reg *httpmock.Registry) {
-				reg.Register(httpmock.REST("GET", "api/v3/"), httpmock.ScopesResponder("repo,read:org"))
-				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org"))
+				reg.Register(httpmock.REST("GET", "api/v3/"), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
+				reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
 				reg.Register(
 					httpmock.GraphQL(`query UserCurrent\b`),
 					httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
@@ -208,6 +287,10 @@ func Test_statusRun(t *testing.T) {
 				tt.opts = &StatusOptions{}
 			}
 
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
 			ios, _, _, stderr := iostreams.Test()
 
 			ios.SetStdinTTY(true)
@@ -236,7 +319,7 @@ func Test_statusRun(t *testing.T) {
 			hostsBuf := bytes.Buffer{}
 			defer config.StubWriteConfig(&mainBuf, &hostsBuf)()
 
-			err := statusRun(tt.opts)
+			err := statusRun(context.Background(), tt.opts)
 			if tt.wantErr != "" {
 				assert.EqualError(t, err, tt.wantErr)
 				return
@@ -257,3 +340,214 @@ func Test_statusRun(t *testing.T) {
 		})
 	}
 }
+
+func Test_statusRun_concurrency(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	ios.SetStdinTTY(true)
+	ios.SetStderrTTY(true)
+	ios.SetStdoutTTY(true)
+
+	cfg := config.NewBlankConfig()
+	_ = cfg.Set("github.com", "oauth_token", "abc123")
+	_ = cfg.Set("ellie.williams", "oauth_token", "abc123")
+
+	// Both host probes block here until released, so the test can prove they
+	// were started concurrently instead of inferring it from elapsed time.
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	blockUntilReleased := func(fn httpmock.Responder) httpmock.Responder {
+		return func(req *http.Request) (*http.Response, error) {
+			started <- struct{}{}
+			<-release
+			return fn(req)
+		}
+	}
+
+	reg := &httpmock.Registry{}
+	reg.Register(httpmock.REST("GET", ""), blockUntilReleased(httpmock.ScopesResponder("repo,read:org,gist,workflow")))
+	reg.Register(httpmock.REST("GET", "api/v3/"), blockUntilReleased(httpmock.ScopesResponder("repo,read:org,gist,workflow")))
+	reg.Register(httpmock.GraphQL(`query UserCurrent\b`), httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
+	reg.Register(httpmock.GraphQL(`query UserCurrent\b`), httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
+
+	opts := &StatusOptions{
+		IO: ios,
+		Config: func() (config.Config, error) {
+			return cfg, nil
+		},
+		HttpClient: func() (*http.Client, error) {
+			return &http.Client{Transport: reg}, nil
+		},
+	}
+
+	mainBuf := bytes.Buffer{}
+	hostsBuf := bytes.Buffer{}
+	defer config.StubWriteConfig(&mainBuf, &hostsBuf)()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- statusRun(context.Background(), opts)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected both hosts to start probing before either finished")
+		}
+	}
+	close(release)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("statusRun did not return after both hosts were released")
+	}
+
+	reg.Verify(t)
+}
+
+func Test_statusRun_failFast(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	ios.SetStdinTTY(true)
+	ios.SetStderrTTY(true)
+	ios.SetStdoutTTY(true)
+
+	cfg := config.NewBlankConfig()
+	_ = cfg.Set("github.com", "oauth_token", "abc123")
+	_ = cfg.Set("ellie.williams", "oauth_token", "abc123")
+
+	reg := &httpmock.Registry{}
+	// With --concurrency 1 hosts are probed one at a time in cfg.Hosts()
+	// order. Whichever host is probed first fails immediately, and with
+	// --fail-fast the other host must never be probed.
+	probed := 0
+	failFirstProbe := func(req *http.Request) (*http.Response, error) {
+		probed++
+		if probed > 1 {
+			t.Error("a second host was probed after the first one failed with --fail-fast")
+		}
+		return httpmock.StatusStringResponse(401, `{}`)(req)
+	}
+	reg.Register(httpmock.REST("GET", "api/v3/"), failFirstProbe)
+	reg.Register(httpmock.REST("GET", ""), failFirstProbe)
+
+	opts := &StatusOptions{
+		IO: ios,
+		Config: func() (config.Config, error) {
+			return cfg, nil
+		},
+		HttpClient: func() (*http.Client, error) {
+			return &http.Client{Transport: reg}, nil
+		},
+		FailFast:    true,
+		Concurrency: 1,
+	}
+
+	mainBuf := bytes.Buffer{}
+	hostsBuf := bytes.Buffer{}
+	defer config.StubWriteConfig(&mainBuf, &hostsBuf)()
+
+	err := statusRun(context.Background(), opts)
+
+	assert.EqualError(t, err, "SilentError")
+}
+
+// fakeExporter is a minimal cmdutil.Exporter that records what it was asked
+// to write, so tests can assert on the structured data without going through
+// the real --json/--jq/--template machinery.
+type fakeExporter struct {
+	data interface{}
+}
+
+func (e *fakeExporter) Fields() []string { return statusFields }
+
+func (e *fakeExporter) Write(ios *iostreams.IOStreams, data interface{}) error {
+	e.data = data
+	return json.NewEncoder(ios.Out).Encode(data)
+}
+
+func Test_statusRun_jsonExport(t *testing.T) {
+	ios, _, stdout, _ := iostreams.Test()
+	ios.SetStdinTTY(true)
+	ios.SetStderrTTY(true)
+	ios.SetStdoutTTY(true)
+
+	cfg := config.NewBlankConfig()
+	_ = cfg.Set("github.com", "oauth_token", "xyz456")
+
+	reg := &httpmock.Registry{}
+	reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo,read:org,gist,workflow"))
+	reg.Register(
+		httpmock.GraphQL(`query UserCurrent\b`),
+		httpmock.StringResponse(`{"data":{"viewer":{"login":"tess"}}}`))
+
+	exporter := &fakeExporter{}
+	opts := &StatusOptions{
+		IO:       ios,
+		Exporter: exporter,
+		Config: func() (config.Config, error) {
+			return cfg, nil
+		},
+		HttpClient: func() (*http.Client, error) {
+			return &http.Client{Transport: reg}, nil
+		},
+	}
+
+	mainBuf := bytes.Buffer{}
+	hostsBuf := bytes.Buffer{}
+	defer config.StubWriteConfig(&mainBuf, &hostsBuf)()
+
+	err := statusRun(context.Background(), opts)
+	assert.NoError(t, err)
+
+	statuses, ok := exporter.data.([]HostStatus)
+	assert.True(t, ok)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "github.com", statuses[0].Hostname)
+	assert.Equal(t, "tess", statuses[0].User)
+	assert.Equal(t, strings.Repeat("*", tokenMaskLength), statuses[0].Token)
+	assert.Equal(t, "", statuses[0].Error)
+	assert.Contains(t, stdout.String(), `"hostname":"github.com"`)
+
+	reg.Verify(t)
+}
+
+func Test_statusRun_jsonExport_failureExitsNonZero(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	ios.SetStdinTTY(true)
+	ios.SetStderrTTY(true)
+	ios.SetStdoutTTY(true)
+
+	cfg := config.NewBlankConfig()
+	_ = cfg.Set("github.com", "oauth_token", "abc123")
+
+	reg := &httpmock.Registry{}
+	reg.Register(httpmock.REST("GET", ""), httpmock.ScopesResponder("repo"))
+
+	exporter := &fakeExporter{}
+	opts := &StatusOptions{
+		IO:       ios,
+		Exporter: exporter,
+		Config: func() (config.Config, error) {
+			return cfg, nil
+		},
+		HttpClient: func() (*http.Client, error) {
+			return &http.Client{Transport: reg}, nil
+		},
+	}
+
+	mainBuf := bytes.Buffer{}
+	hostsBuf := bytes.Buffer{}
+	defer config.StubWriteConfig(&mainBuf, &hostsBuf)()
+
+	err := statusRun(context.Background(), opts)
+	assert.EqualError(t, err, "SilentError")
+
+	statuses, ok := exporter.data.([]HostStatus)
+	assert.True(t, ok)
+	assert.Len(t, statuses, 1)
+	assert.Contains(t, statuses[0].Error, "missing required scopes")
+
+	reg.Verify(t)
+}